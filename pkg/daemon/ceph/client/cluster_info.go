@@ -0,0 +1,43 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+
+	cephver "github.com/rook/rook/pkg/operator/ceph/version"
+)
+
+// ClusterInfo is the per-cluster state needed to run ceph commands and
+// evaluate upgrade checks against a specific cluster.
+type ClusterInfo struct {
+	// CephVersion is the version the cluster is being upgraded to, when an
+	// upgrade is in progress.
+	CephVersion cephver.CephVersion
+	// OsdUpgradeTimeout bounds how long we retry an OSD's ok-to-stop check
+	// before giving up.
+	OsdUpgradeTimeout time.Duration
+	// UpgradeHealthPolicy, when set, configures the staged rollout health
+	// gates evaluated between daemon restarts during an upgrade.
+	UpgradeHealthPolicy *UpgradeHealthPolicy
+	// VersionCache, when set, memoizes 'ceph versions' so it isn't re-run for
+	// every daemon checked during an upgrade.
+	VersionCache *VersionCache
+	// UpgradeObserver, when set, is notified of ok-to-stop/ok-to-continue
+	// check outcomes as an upgrade restarts daemons.
+	UpgradeObserver UpgradeObserver
+}
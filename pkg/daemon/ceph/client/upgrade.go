@@ -132,17 +132,39 @@ func EnableReleaseOSDFunctionality(context *clusterd.Context, clusterInfo *Clust
 	logger.Debug(output)
 	logger.Infof("successfully disallowed pre-%s osds and enabled all new %s-only functionality", release, release)
 
+	// the osd release bump can change what 'ceph versions' reports for the
+	// osds, so any cached view of daemon versions is now stale
+	BustVersionCache(clusterInfo)
+
 	return nil
 }
 
-// OkToStop determines if it's ok to stop an upgrade
+// OkToStop determines if it's ok to stop an upgrade. When clusterInfo.UpgradeObserver
+// is set, it is notified of the skipped/passed/failed/retried outcome of the check.
 func OkToStop(context *clusterd.Context, clusterInfo *ClusterInfo, deployment, daemonType, daemonName string) error {
+	start := time.Now()
+	observer := clusterInfo.UpgradeObserver
 	okToStopRetries, okToStopDelay := getRetryConfig(clusterInfo, daemonType)
-	versions, err := GetAllCephDaemonVersions(context, clusterInfo)
+	versions, err := cachedCephDaemonVersions(context, clusterInfo)
 	if err != nil {
 		return errors.Wrap(err, "failed to get ceph daemons versions")
 	}
 
+	// Reject an upgrade path we know isn't supported before restarting any
+	// more daemons, rather than letting it fail partway through.
+	if clusterInfo.CephVersion.Major != 0 {
+		current, err := oldestMonVersion(versions)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine the mons' current ceph version")
+		}
+		if err := ValidateUpgradePath(current, clusterInfo.CephVersion, versions); err != nil {
+			return errors.Wrap(err, "refusing to continue with an unsupported upgrade path")
+		}
+		if err := RequireOsdReleaseMatches(context, clusterInfo, current); err != nil {
+			return errors.Wrap(err, "refusing to continue with a mismatched require-osd-release")
+		}
+	}
+
 	switch daemonType {
 	// Trying to handle the case where a **single** mon is deployed and an upgrade is called
 	case "mon":
@@ -158,13 +180,15 @@ func OkToStop(context *clusterd.Context, clusterInfo *ClusterInfo, deployment, d
 			for _, monCount := range versions.Mon {
 				if monCount < 3 {
 					logger.Infof("the cluster has less than 3 monitors, not performing upgrade check, running in best-effort")
+					notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckSkipped, Reason: "fewer than 3 monitors", Duration: time.Since(start)})
 					return nil
 				}
 			}
 		}
 	// Trying to handle the case where a **single** osd is deployed and an upgrade is called
 	case "osd":
-		if osdDoNothing(context, clusterInfo) {
+		if reason, skip := osdDoNothing(context, clusterInfo); skip {
+			notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckSkipped, Reason: reason, Duration: time.Since(start)})
 			return nil
 		}
 	}
@@ -173,31 +197,64 @@ func OkToStop(context *clusterd.Context, clusterInfo *ClusterInfo, deployment, d
 	//  - mon: the is done in the monitor code since it ensures all the mons are always in quorum before continuing
 	//  - rgw: the pod spec has a liveness probe so if the pod successfully start
 	//  - rbdmirror: you can chain as many as you want like mdss but there is no ok-to-stop logic yet
+	attempt := 0
 	err = util.Retry(okToStopRetries, okToStopDelay, func() error {
-		return okToStopDaemon(context, clusterInfo, deployment, daemonType, daemonName)
+		attempt++
+		checkErr := okToStopDaemon(context, clusterInfo, deployment, daemonType, daemonName)
+		if checkErr != nil {
+			notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckRetried, Reason: checkErr.Error(), Retry: attempt, Duration: time.Since(start)})
+		}
+		return checkErr
 	})
 	if err != nil {
+		notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckFailed, Reason: err.Error(), Retry: attempt, Duration: time.Since(start)})
 		return errors.Wrapf(err, "failed to check if %s was ok to stop", deployment)
 	}
 
+	// note: the cache is busted in OkToContinue, once the daemon has actually
+	// been restarted, not here. Busting on every iteration of the upgrade
+	// loop would force a fresh 'ceph versions' exec for the very next daemon
+	// checked and defeat the point of the cache.
+
+	notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckPassed, Retry: attempt, Duration: time.Since(start)})
+
 	return nil
 }
 
-// OkToContinue determines if it's ok to continue an upgrade
+// OkToContinue determines if it's ok to continue an upgrade. When
+// clusterInfo.UpgradeObserver is set, it is notified of the passed/failed
+// outcome of the check.
 func OkToContinue(context *clusterd.Context, clusterInfo *ClusterInfo, deployment, daemonType, daemonName string) error {
+	start := time.Now()
+	observer := clusterInfo.UpgradeObserver
+
+	// by the time the caller asks if it's ok to continue, it has already
+	// restarted this daemon; bust the version cache now so the next OkToStop
+	// call sees its new version instead of a stale pre-restart one for up to
+	// the cache's ttl.
+	BustVersionCache(clusterInfo)
+
 	// the mon case is handled directly in the deployment where the mon checks for quorum
 	switch daemonType {
 	case "mds":
 		err := okToContinueMDSDaemon(context, clusterInfo, deployment, daemonType, daemonName)
 		if err != nil {
+			notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckFailed, Reason: err.Error(), Duration: time.Since(start)})
 			return errors.Wrapf(err, "failed to check if %s was ok to continue", deployment)
 		}
+		notify(observer, UpgradeCheckEvent{DaemonType: daemonType, DaemonName: daemonName, Outcome: UpgradeCheckPassed, Duration: time.Since(start)})
 	}
 
 	return nil
 }
 
 func okToStopDaemon(context *clusterd.Context, clusterInfo *ClusterInfo, deployment, daemonType, daemonName string) error {
+	// The staged rollout policy, when configured, must be satisfied in addition
+	// to the built-in ok-to-stop command before we restart another daemon.
+	if err := runHealthGates(context, clusterInfo); err != nil {
+		return errors.Wrapf(err, "deployment %s cannot be stopped", deployment)
+	}
+
 	if !StringInSlice(daemonType, daemonNoCheck) {
 		args := []string{daemonType, "ok-to-stop", daemonName}
 		buf, err := NewCephCommand(context, clusterInfo, args).Run()
@@ -257,7 +314,7 @@ func LeastUptodateDaemonVersion(context *clusterd.Context, clusterInfo *ClusterI
 	var vv cephver.CephVersion
 
 	// Always invoke ceph version before an upgrade so we are sure to be up-to-date
-	versions, err := GetAllCephDaemonVersions(context, clusterInfo)
+	versions, err := cachedCephDaemonVersions(context, clusterInfo)
 	if err != nil {
 		return vv, errors.Wrap(err, "failed to get ceph daemons versions")
 	}
@@ -358,8 +415,8 @@ func buildHostListFromTree(tree OsdTree) (OsdTree, error) {
 
 // osdDoNothing determines whether we should perform upgrade pre-check and post-checks for the OSD daemon
 // it checks for various cluster info like number of OSD and their placement
-// it returns 'true' if we need to do nothing and false and we should pre-check/post-check
-func osdDoNothing(context *clusterd.Context, clusterInfo *ClusterInfo) bool {
+// it returns 'true' if we need to do nothing, along with the reason why, and false if we should pre-check/post-check
+func osdDoNothing(context *clusterd.Context, clusterInfo *ClusterInfo) (string, bool) {
 	osds, err := OsdListNum(context, clusterInfo)
 	if err != nil {
 		logger.Warningf("failed to determine the total number of osds. will check if the osd is ok-to-stop anyways. %v", err)
@@ -367,11 +424,11 @@ func osdDoNothing(context *clusterd.Context, clusterInfo *ClusterInfo) bool {
 		// If there are less than 3 OSDs, the ok-to-stop call will fail
 		// this can still be controlled by setting continueUpgradeAfterChecksEvenIfNotHealthy
 		// At least this will happen for a single OSD only, which means 2 OSDs will restart in a small interval
-		return false
+		return "", false
 	}
 	if len(osds) < 3 {
 		logger.Warningf("the cluster has less than 3 osds, not performing upgrade check, running in best-effort")
-		return true
+		return "fewer than 3 osds", true
 	}
 
 	// aio means all in one
@@ -379,15 +436,15 @@ func osdDoNothing(context *clusterd.Context, clusterInfo *ClusterInfo) bool {
 	if err != nil {
 		// If calling osd list fails, we assume there are more than 3 OSDs and we check if ok-to-stop
 		logger.Warningf("failed to determine if all osds are running on the same host, performing upgrade check anyways. %v", err)
-		return false
+		return "", false
 	}
 
 	if aio {
 		logger.Warningf("all OSDs are running on the same host, not performing upgrade check, running in best-effort")
-		return true
+		return "all osds on the same host", true
 	}
 
-	return false
+	return "", false
 }
 
 func getRetryConfig(clusterInfo *ClusterInfo, daemonType string) (int, time.Duration) {
@@ -0,0 +1,224 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// defaultFailureDomain is the CRUSH bucket type OSDs are grouped by when the
+// caller doesn't request a different one.
+const defaultFailureDomain = "host"
+
+// DaemonRef identifies a single OSD to be considered for a batched ok-to-stop
+// check.
+type DaemonRef struct {
+	// ID is the numeric OSD id, e.g. 3 for osd.3.
+	ID int
+	// Deployment is the owning deployment name, e.g. rook-ceph-osd-3.
+	Deployment string
+}
+
+// OkToStopBatch inspects the CRUSH tree, groups the given OSDs by failure
+// domain (host, by default; pass a different CRUSH bucket type via
+// failureDomain to group by rack/room/etc. instead), and returns a subset of
+// them that can be restarted concurrently without violating pool min_size or
+// crush rules. The subset is found by bisecting batches that ceph refuses, so
+// it is not necessarily the largest such subset. It calls
+// 'ceph osd ok-to-stop <id> [<id>...]',
+// which accepts multiple ids on Octopus and newer, and falls back to
+// checking each OSD individually when the batched command isn't supported.
+func OkToStopBatch(context *clusterd.Context, clusterInfo *ClusterInfo, deployments []DaemonRef, failureDomain string) ([]DaemonRef, error) {
+	if failureDomain == "" {
+		failureDomain = defaultFailureDomain
+	}
+
+	if len(deployments) == 0 {
+		return nil, nil
+	}
+
+	tree, err := HostTree(context, clusterInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the osd tree")
+	}
+
+	domains := groupByFailureDomain(tree, deployments, failureDomain)
+
+	var safeToStop []DaemonRef
+	for domain, group := range domains {
+		ok, err := okToStopOSDs(context, clusterInfo, group)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check if osds in failure domain %s are ok to stop", domain)
+		}
+		safeToStop = append(safeToStop, ok...)
+	}
+
+	// each failure domain was checked on its own; ceph must also accept
+	// stopping all of them at once before they're reported as one set
+	if len(domains) > 1 {
+		return okToStopOSDs(context, clusterInfo, safeToStop)
+	}
+
+	return safeToStop, nil
+}
+
+// crushNode is the subset of an OsdTree node we need to walk the tree and
+// identify failure domains.
+type crushNode struct {
+	name string
+	typ  string
+}
+
+// groupByFailureDomain buckets deployments by the name of their ancestor
+// CRUSH node of type failureDomain. OSDs whose failure domain can't be
+// determined from the tree are each placed in their own single-member group
+// so they're still checked, just serially.
+func groupByFailureDomain(tree OsdTree, deployments []DaemonRef, failureDomain string) map[string][]DaemonRef {
+	parent := map[int]int{}
+	nodeByID := map[int]crushNode{}
+	for _, n := range tree.Nodes {
+		nodeByID[n.ID] = crushNode{name: n.Name, typ: n.Type}
+		for _, childID := range n.Children {
+			parent[childID] = n.ID
+		}
+	}
+
+	domains := map[string][]DaemonRef{}
+	for _, d := range deployments {
+		name, ok := ancestorOfType(d.ID, failureDomain, parent, nodeByID)
+		if !ok {
+			name = strconv.Itoa(d.ID)
+		}
+		domains[name] = append(domains[name], d)
+	}
+
+	return domains
+}
+
+// ancestorOfType walks up the CRUSH tree from osdID until it finds a node of
+// the requested type, returning its name.
+func ancestorOfType(osdID int, failureDomain string, parent map[int]int, nodeByID map[int]crushNode) (string, bool) {
+	id := osdID
+	for {
+		parentID, ok := parent[id]
+		if !ok {
+			return "", false
+		}
+
+		node, ok := nodeByID[parentID]
+		if !ok {
+			return "", false
+		}
+		if node.typ == failureDomain {
+			return node.name, true
+		}
+
+		id = parentID
+	}
+}
+
+// okToStopOSDs tries the batched 'ceph osd ok-to-stop' call for every OSD in
+// group at once. If the running Ceph version doesn't understand multiple
+// ids, it falls back to checking each OSD individually. If Ceph does
+// understand the batch and rejects it, stopping the whole group concurrently
+// would violate min_size or crush rules, so the group is bisected and each
+// half is retried instead of conflating the denial with "check them one by
+// one and union whatever passes" -- the latter would happily report the
+// whole group as concurrently safe as long as every member is individually
+// ok to stop, which is exactly the data-unavailability scenario this check
+// exists to prevent.
+func okToStopOSDs(context *clusterd.Context, clusterInfo *ClusterInfo, group []DaemonRef) ([]DaemonRef, error) {
+	if len(group) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"osd", "ok-to-stop"}
+	for _, d := range group {
+		args = append(args, strconv.Itoa(d.ID))
+	}
+
+	_, err := NewCephCommand(context, clusterInfo, args).Run()
+	if err == nil {
+		return group, nil
+	}
+
+	if len(group) == 1 {
+		logger.Debugf("osd.%d is not ok to stop: %v", group[0].ID, err)
+		return nil, nil
+	}
+
+	if isBatchUnsupported(err) {
+		logger.Debugf("batched ok-to-stop is not supported by this ceph version, falling back to per-osd checks for %d osds", len(group))
+
+		var safeToStop []DaemonRef
+		for _, d := range group {
+			ok, err := okToStopOSDs(context, clusterInfo, []DaemonRef{d})
+			if err != nil {
+				return nil, err
+			}
+			safeToStop = append(safeToStop, ok...)
+		}
+
+		return safeToStop, nil
+	}
+
+	// ceph understood the batch and refused it; don't claim the whole group
+	// is safe to stop together, narrow it down instead.
+	logger.Debugf("%d osds are not ok to stop together, bisecting: %v", len(group), err)
+
+	mid := len(group) / 2
+	left, err := okToStopOSDs(context, clusterInfo, group[:mid])
+	if err != nil {
+		return nil, err
+	}
+	right, err := okToStopOSDs(context, clusterInfo, group[mid:])
+	if err != nil {
+		return nil, err
+	}
+	if len(left) == 0 || len(right) == 0 {
+		return append(left, right...), nil
+	}
+
+	// each half passing on its own doesn't make them safe to stop together:
+	// report both only if ceph accepts them as one batch, else the larger half
+	combined := append(append([]DaemonRef{}, left...), right...)
+	combinedArgs := []string{"osd", "ok-to-stop"}
+	for _, d := range combined {
+		combinedArgs = append(combinedArgs, strconv.Itoa(d.ID))
+	}
+	if _, err := NewCephCommand(context, clusterInfo, combinedArgs).Run(); err == nil {
+		return combined, nil
+	}
+	if len(left) >= len(right) {
+		return left, nil
+	}
+
+	return right, nil
+}
+
+// isBatchUnsupported reports whether err looks like Ceph rejected the
+// 'ok-to-stop' command for not recognizing multiple osd ids (pre-Octopus),
+// as opposed to understanding the batch and refusing it because stopping it
+// would be unsafe.
+func isBatchUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "invalid command") || strings.Contains(msg, "unrecognized command")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// idsFromArgs pulls the numeric osd ids out of a 'ceph osd ok-to-stop' args
+// slice, ignoring any other flags the command wrapper adds.
+func idsFromArgs(args []string) []int {
+	var ids []int
+	for _, a := range args {
+		if id, err := strconv.Atoi(a); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// mockOkToStopExecutor returns an executor for 'ceph osd ok-to-stop' calls
+// whose error (nil for "ok to stop") is keyed by the sorted set of osd ids
+// requested, regardless of what other args the command wrapper adds.
+func mockOkToStopExecutor(responses map[string]error) *exectest.MockExecutor {
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			key := fmt.Sprint(idsFromArgs(args))
+			return "", responses[key]
+		},
+	}
+}
+
+func TestGroupByFailureDomain(t *testing.T) {
+	// root -> rack-a -> host-a -> osd.0, osd.1
+	//               -> host-b -> osd.2
+	tree := OsdTree{
+		Nodes: []Node{
+			{ID: -1, Name: "default", Type: "root", Children: []int{-2}},
+			{ID: -2, Name: "rack-a", Type: "rack", Children: []int{-3, -4}},
+			{ID: -3, Name: "host-a", Type: "host", Children: []int{0, 1}},
+			{ID: -4, Name: "host-b", Type: "host", Children: []int{2}},
+		},
+	}
+
+	deployments := []DaemonRef{
+		{ID: 0, Deployment: "rook-ceph-osd-0"},
+		{ID: 1, Deployment: "rook-ceph-osd-1"},
+		{ID: 2, Deployment: "rook-ceph-osd-2"},
+		{ID: 99, Deployment: "rook-ceph-osd-99"},
+	}
+
+	t.Run("groups by host by default", func(t *testing.T) {
+		domains := groupByFailureDomain(tree, deployments, defaultFailureDomain)
+
+		assert.ElementsMatch(t, []DaemonRef{{ID: 0, Deployment: "rook-ceph-osd-0"}, {ID: 1, Deployment: "rook-ceph-osd-1"}}, domains["host-a"])
+		assert.ElementsMatch(t, []DaemonRef{{ID: 2, Deployment: "rook-ceph-osd-2"}}, domains["host-b"])
+		// an osd missing from the tree still gets checked, just on its own
+		assert.ElementsMatch(t, []DaemonRef{{ID: 99, Deployment: "rook-ceph-osd-99"}}, domains["99"])
+	})
+
+	t.Run("groups by a different failure domain", func(t *testing.T) {
+		domains := groupByFailureDomain(tree, deployments, "rack")
+
+		assert.ElementsMatch(t, []DaemonRef{
+			{ID: 0, Deployment: "rook-ceph-osd-0"},
+			{ID: 1, Deployment: "rook-ceph-osd-1"},
+			{ID: 2, Deployment: "rook-ceph-osd-2"},
+		}, domains["rack-a"])
+	})
+}
+
+func TestOkToStopOSDs(t *testing.T) {
+	clusterInfo := &ClusterInfo{}
+
+	t.Run("returns the whole group when the batch succeeds", func(t *testing.T) {
+		context := &clusterd.Context{Executor: mockOkToStopExecutor(nil)}
+		group := []DaemonRef{{ID: 0}, {ID: 1}, {ID: 2}}
+
+		safe, err := okToStopOSDs(context, clusterInfo, group)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, group, safe)
+	})
+
+	t.Run("falls back to per-osd checks when batching isn't supported", func(t *testing.T) {
+		responses := map[string]error{
+			"[10 11]": fmt.Errorf("Error EINVAL: invalid command"),
+		}
+		context := &clusterd.Context{Executor: mockOkToStopExecutor(responses)}
+		group := []DaemonRef{{ID: 10}, {ID: 11}}
+
+		safe, err := okToStopOSDs(context, clusterInfo, group)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, group, safe)
+	})
+
+	t.Run("bisects instead of unioning individually-passing osds when ceph denies the batch", func(t *testing.T) {
+		// ceph understands the batch and genuinely refuses to stop all 4 at
+		// once, and also refuses the first half on its own; only osd.1 is
+		// individually not ok to stop.
+		responses := map[string]error{
+			"[0 1 2 3]": fmt.Errorf("Error EBUSY: unsafe to stop osd(s) at this time"),
+			"[0 1]":     fmt.Errorf("Error EBUSY: unsafe to stop osd(s) at this time"),
+			"[1]":       fmt.Errorf("Error EBUSY: osd.1 is currently in use"),
+		}
+		context := &clusterd.Context{Executor: mockOkToStopExecutor(responses)}
+		group := []DaemonRef{{ID: 0}, {ID: 1}, {ID: 2}, {ID: 3}}
+
+		safe, err := okToStopOSDs(context, clusterInfo, group)
+		assert.NoError(t, err)
+		// osd.1 must never be reported safe, and the group must never be
+		// reported safe to stop all together
+		assert.ElementsMatch(t, []DaemonRef{{ID: 0}, {ID: 2}, {ID: 3}}, safe)
+	})
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// HealthGate is a pre-restart health check that must pass before a daemon is
+// considered ok-to-stop. It returns a non-nil error describing why the gate
+// did not pass.
+type HealthGate func(context *clusterd.Context, clusterInfo *ClusterInfo) error
+
+// UpgradeHealthPolicy configures the staged rollout checks that run, in
+// addition to the built-in 'ok-to-stop' command, between daemon restarts
+// during an upgrade. A nil policy (the default) preserves the previous
+// behavior of relying solely on 'ok-to-stop'.
+type UpgradeHealthPolicy struct {
+	// MinPGActiveCleanPercent is the minimum percentage of PGs that must be
+	// active+clean before another daemon can be restarted.
+	MinPGActiveCleanPercent float64
+	// MaxSlowOps is the maximum number of slow ops tolerated cluster-wide
+	// before another daemon can be restarted.
+	MaxSlowOps int
+	// MaxRecoveryTimeSeconds bounds the estimated recovery time reported by
+	// 'ceph status' before another daemon can be restarted.
+	MaxRecoveryTimeSeconds int
+	// Gates are additional health checks run, in order, after the built-in
+	// ones derived from the fields above. All gates must pass.
+	Gates []HealthGate
+}
+
+// HealthGateError identifies which health gate blocked a restart during a
+// staged rollout so callers can report the specific cause.
+type HealthGateError struct {
+	GateName string
+	Reason   string
+}
+
+func (e *HealthGateError) Error() string {
+	return "health gate " + e.GateName + " failed: " + e.Reason
+}
+
+// pgProgress is the subset of 'ceph status' we need to evaluate the
+// PG-active-clean and recovery-time gates.
+type pgProgress struct {
+	PgMap struct {
+		NumPgs     int `json:"num_pgs"`
+		PgsByState []struct {
+			StateName string `json:"state_name"`
+			Count     int    `json:"count"`
+		} `json:"pgs_by_state"`
+		DegradedObjects int `json:"degraded_objects"`
+		RecoveryRate    struct {
+			RecoveringObjectsPerSec float64 `json:"recovering_objects_per_sec"`
+		} `json:"recovery_rate"`
+	} `json:"pgmap"`
+	HealthChecks map[string]struct {
+		Severity string `json:"severity"`
+		Summary  struct {
+			Message string `json:"message"`
+			Count   int    `json:"count"`
+		} `json:"summary"`
+	} `json:"health,omitempty"`
+}
+
+func getCephStatus(context *clusterd.Context, clusterInfo *ClusterInfo) (*pgProgress, error) {
+	args := []string{"status"}
+	buf, err := NewCephCommand(context, clusterInfo, args).Run()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run 'ceph status'")
+	}
+
+	var status pgProgress
+	if err := json.Unmarshal(buf, &status); err != nil {
+		return nil, errors.Wrap(err, "failed to parse 'ceph status' output")
+	}
+
+	return &status, nil
+}
+
+// runHealthGates evaluates the policy's built-in gates followed by any
+// custom gates registered on clusterInfo.UpgradeHealthPolicy, short-circuiting
+// on the first one that fails.
+func runHealthGates(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+	policy := clusterInfo.UpgradeHealthPolicy
+	if policy == nil {
+		return nil
+	}
+
+	builtins := []struct {
+		name string
+		gate HealthGate
+	}{
+		{"pg-active-clean", pgActiveCleanGate(policy)},
+		{"slow-ops", slowOpsGate(policy)},
+		{"recovery-time", recoveryTimeGate(policy)},
+	}
+
+	for _, b := range builtins {
+		if b.gate == nil {
+			continue
+		}
+		if err := b.gate(context, clusterInfo); err != nil {
+			return &HealthGateError{GateName: b.name, Reason: err.Error()}
+		}
+	}
+
+	for i, gate := range policy.Gates {
+		if err := gate(context, clusterInfo); err != nil {
+			return &HealthGateError{GateName: errors.Errorf("custom-%d", i).Error(), Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// pgActiveCleanGate fails unless at least MinPGActiveCleanPercent of PGs are
+// active+clean. A zero threshold disables the gate.
+func pgActiveCleanGate(policy *UpgradeHealthPolicy) HealthGate {
+	if policy.MinPGActiveCleanPercent == 0 {
+		return nil
+	}
+
+	return func(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+		status, err := getCephStatus(context, clusterInfo)
+		if err != nil {
+			return err
+		}
+
+		if status.PgMap.NumPgs == 0 {
+			return nil
+		}
+
+		var activeClean int
+		for _, s := range status.PgMap.PgsByState {
+			if s.StateName == "active+clean" {
+				activeClean = s.Count
+			}
+		}
+
+		percent := (float64(activeClean) / float64(status.PgMap.NumPgs)) * 100
+		if percent < policy.MinPGActiveCleanPercent {
+			return errors.Errorf("only %.2f%% of PGs are active+clean, want at least %.2f%%", percent, policy.MinPGActiveCleanPercent)
+		}
+
+		return nil
+	}
+}
+
+// slowOpsGate fails when the cluster reports more than MaxSlowOps slow ops. A
+// zero threshold disables the gate.
+func slowOpsGate(policy *UpgradeHealthPolicy) HealthGate {
+	if policy.MaxSlowOps == 0 {
+		return nil
+	}
+
+	return func(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+		status, err := getCephStatus(context, clusterInfo)
+		if err != nil {
+			return err
+		}
+
+		check, ok := status.HealthChecks["SLOW_OPS"]
+		if !ok {
+			return nil
+		}
+
+		if check.Summary.Count <= policy.MaxSlowOps {
+			return nil
+		}
+
+		return errors.Errorf("%d slow ops reported, want at most %d: %s", check.Summary.Count, policy.MaxSlowOps, check.Summary.Message)
+	}
+}
+
+// recoveryTimeGate fails when the estimated time to finish recovering
+// degraded objects, at the cluster's current recovery rate, exceeds
+// MaxRecoveryTimeSeconds. A zero threshold disables the gate. The estimate is
+// skipped (the gate passes) when the cluster isn't actively recovering, since
+// there's no rate to estimate from.
+func recoveryTimeGate(policy *UpgradeHealthPolicy) HealthGate {
+	if policy.MaxRecoveryTimeSeconds == 0 {
+		return nil
+	}
+
+	return func(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+		status, err := getCephStatus(context, clusterInfo)
+		if err != nil {
+			return err
+		}
+
+		rate := status.PgMap.RecoveryRate.RecoveringObjectsPerSec
+		if rate <= 0 || status.PgMap.DegradedObjects == 0 {
+			return nil
+		}
+
+		etaSeconds := int(float64(status.PgMap.DegradedObjects) / rate)
+		if etaSeconds > policy.MaxRecoveryTimeSeconds {
+			return errors.Errorf("estimated recovery time %ds exceeds max of %ds", etaSeconds, policy.MaxRecoveryTimeSeconds)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeCephStatusContext(statusJSON string) *clusterd.Context {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return statusJSON, nil
+		},
+	}
+	return &clusterd.Context{Executor: executor}
+}
+
+func TestPgActiveCleanGate(t *testing.T) {
+	policy := &UpgradeHealthPolicy{MinPGActiveCleanPercent: 90}
+	gate := pgActiveCleanGate(policy)
+
+	t.Run("passes when enough pgs are active+clean", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":95}]}}`)
+		assert.NoError(t, gate(context, &ClusterInfo{}))
+	})
+
+	t.Run("fails when too few pgs are active+clean", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":50}]}}`)
+		err := gate(context, &ClusterInfo{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "50.00%")
+	})
+
+	t.Run("passes trivially when there are no pgs yet", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"pgmap":{"num_pgs":0}}`)
+		assert.NoError(t, gate(context, &ClusterInfo{}))
+	})
+
+	t.Run("a zero threshold disables the gate", func(t *testing.T) {
+		assert.Nil(t, pgActiveCleanGate(&UpgradeHealthPolicy{}))
+	})
+}
+
+func TestSlowOpsGate(t *testing.T) {
+	policy := &UpgradeHealthPolicy{MaxSlowOps: 10}
+	gate := slowOpsGate(policy)
+
+	t.Run("passes when no SLOW_OPS health check is reported", func(t *testing.T) {
+		context := fakeCephStatusContext(`{}`)
+		assert.NoError(t, gate(context, &ClusterInfo{}))
+	})
+
+	t.Run("passes when slow ops are within the threshold", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"health":{"SLOW_OPS":{"severity":"HEALTH_WARN","summary":{"message":"5 slow ops","count":5}}}}`)
+		assert.NoError(t, gate(context, &ClusterInfo{}))
+	})
+
+	t.Run("fails when slow ops exceed the threshold", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"health":{"SLOW_OPS":{"severity":"HEALTH_WARN","summary":{"message":"100 slow ops","count":100}}}}`)
+		err := gate(context, &ClusterInfo{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "100 slow ops reported, want at most 10")
+	})
+
+	t.Run("a zero threshold disables the gate", func(t *testing.T) {
+		assert.Nil(t, slowOpsGate(&UpgradeHealthPolicy{}))
+	})
+}
+
+func TestRecoveryTimeGate(t *testing.T) {
+	policy := &UpgradeHealthPolicy{MaxRecoveryTimeSeconds: 60}
+	gate := recoveryTimeGate(policy)
+
+	t.Run("passes when the cluster isn't recovering", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"pgmap":{"degraded_objects":0,"recovery_rate":{"recovering_objects_per_sec":0}}}`)
+		assert.NoError(t, gate(context, &ClusterInfo{}))
+	})
+
+	t.Run("passes when the estimated recovery time is within the threshold", func(t *testing.T) {
+		// 100 degraded objects at 10/sec = 10s, well under the 60s threshold
+		context := fakeCephStatusContext(`{"pgmap":{"degraded_objects":100,"recovery_rate":{"recovering_objects_per_sec":10}}}`)
+		assert.NoError(t, gate(context, &ClusterInfo{}))
+	})
+
+	t.Run("fails when the estimated recovery time exceeds the threshold", func(t *testing.T) {
+		// 1000 degraded objects at 1/sec = 1000s, well over the 60s threshold
+		context := fakeCephStatusContext(`{"pgmap":{"degraded_objects":1000,"recovery_rate":{"recovering_objects_per_sec":1}}}`)
+		err := gate(context, &ClusterInfo{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds max of 60s")
+	})
+
+	t.Run("a zero threshold disables the gate", func(t *testing.T) {
+		assert.Nil(t, recoveryTimeGate(&UpgradeHealthPolicy{}))
+	})
+}
+
+func TestRunHealthGates(t *testing.T) {
+	t.Run("passes when no policy is configured", func(t *testing.T) {
+		assert.NoError(t, runHealthGates(&clusterd.Context{}, &ClusterInfo{}))
+	})
+
+	t.Run("reports which built-in gate failed", func(t *testing.T) {
+		context := fakeCephStatusContext(`{"health":{"SLOW_OPS":{"severity":"HEALTH_WARN","summary":{"message":"too many","count":100}}}}`)
+		clusterInfo := &ClusterInfo{UpgradeHealthPolicy: &UpgradeHealthPolicy{MaxSlowOps: 10}}
+
+		err := runHealthGates(context, clusterInfo)
+		assert.Error(t, err)
+		gateErr, ok := err.(*HealthGateError)
+		assert.True(t, ok)
+		assert.Equal(t, "slow-ops", gateErr.GateName)
+	})
+
+	t.Run("runs custom gates after the built-ins and stops at the first failure", func(t *testing.T) {
+		context := fakeCephStatusContext(`{}`)
+		var secondGateCalled bool
+		clusterInfo := &ClusterInfo{
+			UpgradeHealthPolicy: &UpgradeHealthPolicy{
+				Gates: []HealthGate{
+					func(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+						return errors.New("custom gate refused")
+					},
+					func(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+						secondGateCalled = true
+						return nil
+					},
+				},
+			},
+		}
+
+		err := runHealthGates(context, clusterInfo)
+		assert.Error(t, err)
+		assert.False(t, secondGateCalled)
+	})
+}
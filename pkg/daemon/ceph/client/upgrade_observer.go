@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// UpgradeCheckOutcome describes the result of a single ok-to-stop/ok-to-continue
+// decision made while restarting a daemon during an upgrade.
+type UpgradeCheckOutcome string
+
+const (
+	// UpgradeCheckSkipped means the check was bypassed, e.g. because the
+	// cluster is too small to safely enforce it.
+	UpgradeCheckSkipped UpgradeCheckOutcome = "skipped"
+	// UpgradeCheckPassed means the daemon was confirmed ok to restart.
+	UpgradeCheckPassed UpgradeCheckOutcome = "passed"
+	// UpgradeCheckFailed means the daemon was not ok to restart and all
+	// retries have been exhausted.
+	UpgradeCheckFailed UpgradeCheckOutcome = "failed"
+	// UpgradeCheckRetried means the daemon was not yet ok to restart but
+	// another attempt will be made.
+	UpgradeCheckRetried UpgradeCheckOutcome = "retried"
+)
+
+// UpgradeCheckEvent carries the details of a single upgrade check decision to
+// an UpgradeObserver.
+type UpgradeCheckEvent struct {
+	DaemonType string
+	DaemonName string
+	Outcome    UpgradeCheckOutcome
+	Reason     string
+	Retry      int
+	Duration   time.Duration
+}
+
+// UpgradeObserver is notified of every ok-to-stop/ok-to-continue decision
+// made while an upgrade restarts daemons, so operators have visibility into
+// why an upgrade is progressing, retrying, or stalled beyond grepping logs.
+type UpgradeObserver interface {
+	Observe(event UpgradeCheckEvent)
+}
+
+// notify calls observer.Observe if observer is non-nil, so call sites don't
+// need to nil-check before every notification.
+func notify(observer UpgradeObserver, event UpgradeCheckEvent) {
+	if observer != nil {
+		observer.Observe(event)
+	}
+}
+
+// EventObserver is an UpgradeObserver that records each upgrade check outcome
+// as a Kubernetes Event against the owning CephCluster.
+type EventObserver struct {
+	recorder    record.EventRecorder
+	cephCluster runtime.Object
+}
+
+// NewEventObserver returns an EventObserver that emits Events against
+// cephCluster using recorder.
+func NewEventObserver(recorder record.EventRecorder, cephCluster runtime.Object) *EventObserver {
+	return &EventObserver{recorder: recorder, cephCluster: cephCluster}
+}
+
+// Observe implements UpgradeObserver.
+func (e *EventObserver) Observe(event UpgradeCheckEvent) {
+	eventType := corev1.EventTypeNormal
+	if event.Outcome == UpgradeCheckFailed {
+		eventType = corev1.EventTypeWarning
+	}
+
+	reason := "UpgradeCheck" + strings.Title(string(event.Outcome))
+	message := fmt.Sprintf("%s/%s: %s", event.DaemonType, event.DaemonName, event.Outcome)
+	if event.Reason != "" {
+		message += ": " + event.Reason
+	}
+	if event.Retry > 0 {
+		message += fmt.Sprintf(" (retry %d)", event.Retry)
+	}
+
+	e.recorder.Event(e.cephCluster, eventType, reason, message)
+}
+
+// MetricsObserver is an UpgradeObserver that exports Prometheus counters and
+// histograms describing upgrade check outcomes.
+type MetricsObserver struct {
+	okToStopTotal *prometheus.CounterVec
+	checkDuration *prometheus.HistogramVec
+}
+
+// NewMetricsObserver returns a MetricsObserver with its metrics registered
+// against registerer.
+func NewMetricsObserver(registerer prometheus.Registerer) *MetricsObserver {
+	m := &MetricsObserver{
+		okToStopTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rook_ceph_upgrade_ok_to_stop_total",
+			Help: "Total number of ok-to-stop/ok-to-continue check outcomes observed during a Ceph upgrade, by daemon type and outcome",
+		}, []string{"daemon_type", "outcome"}),
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "rook_ceph_upgrade_check_duration_seconds",
+			Help: "Duration of ok-to-stop/ok-to-continue checks performed during a Ceph upgrade, by daemon type",
+		}, []string{"daemon_type"}),
+	}
+
+	registerer.MustRegister(m.okToStopTotal, m.checkDuration)
+
+	return m
+}
+
+// Observe implements UpgradeObserver.
+func (m *MetricsObserver) Observe(event UpgradeCheckEvent) {
+	m.okToStopTotal.WithLabelValues(event.DaemonType, string(event.Outcome)).Inc()
+	m.checkDuration.WithLabelValues(event.DaemonType).Observe(event.Duration.Seconds())
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeObserver struct {
+	events []UpgradeCheckEvent
+}
+
+func (f *fakeObserver) Observe(event UpgradeCheckEvent) {
+	f.events = append(f.events, event)
+}
+
+func TestNotify(t *testing.T) {
+	t.Run("is a no-op when the observer is nil", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			notify(nil, UpgradeCheckEvent{})
+		})
+	})
+
+	t.Run("forwards the event to the observer", func(t *testing.T) {
+		observer := &fakeObserver{}
+		event := UpgradeCheckEvent{DaemonType: "osd", DaemonName: "osd0", Outcome: UpgradeCheckPassed}
+
+		notify(observer, event)
+
+		assert.Equal(t, []UpgradeCheckEvent{event}, observer.events)
+	})
+}
+
+func TestEventObserverObserve(t *testing.T) {
+	t.Run("emits a warning event when the check failed", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(1)
+		observer := NewEventObserver(recorder, &corev1.Pod{})
+
+		observer.Observe(UpgradeCheckEvent{DaemonType: "osd", DaemonName: "osd0", Outcome: UpgradeCheckFailed, Reason: "not ok to stop", Retry: 2})
+
+		event := <-recorder.Events
+		assert.Contains(t, event, corev1.EventTypeWarning)
+		assert.Contains(t, event, "osd/osd0: failed")
+		assert.Contains(t, event, "not ok to stop")
+		assert.Contains(t, event, "retry 2")
+	})
+
+	t.Run("emits a normal event when the check passed", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(1)
+		observer := NewEventObserver(recorder, &corev1.Pod{})
+
+		observer.Observe(UpgradeCheckEvent{DaemonType: "mon", DaemonName: "mon0", Outcome: UpgradeCheckPassed})
+
+		event := <-recorder.Events
+		assert.Contains(t, event, corev1.EventTypeNormal)
+		assert.Contains(t, event, "mon/mon0: passed")
+	})
+}
+
+func TestMetricsObserverObserve(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	observer := NewMetricsObserver(registry)
+
+	observer.Observe(UpgradeCheckEvent{DaemonType: "osd", Outcome: UpgradeCheckPassed, Duration: 2 * time.Second})
+	observer.Observe(UpgradeCheckEvent{DaemonType: "osd", Outcome: UpgradeCheckPassed, Duration: time.Second})
+	observer.Observe(UpgradeCheckEvent{DaemonType: "osd", Outcome: UpgradeCheckFailed, Duration: time.Second})
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(observer.okToStopTotal.WithLabelValues("osd", string(UpgradeCheckPassed))))
+	assert.Equal(t, float64(1), testutil.ToFloat64(observer.okToStopTotal.WithLabelValues("osd", string(UpgradeCheckFailed))))
+
+	count, err := testutil.GatherAndCount(registry, "rook_ceph_upgrade_check_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/rook/rook/pkg/clusterd"
+	cephver "github.com/rook/rook/pkg/operator/ceph/version"
+)
+
+// maxSupportedMajorJump is the largest major-version jump Ceph supports in a
+// single upgrade, e.g. nautilus -> octopus is fine, nautilus -> pacific is not.
+const maxSupportedMajorJump = 1
+
+// maxOsdMonMajorLag is how many major releases behind the newest mon an OSD
+// is allowed to be.
+const maxOsdMonMajorLag = 2
+
+// ValidateUpgradePath enforces Ceph's supported upgrade constraints before an
+// upgrade from current to target is allowed to start:
+//   - target is at most one major version ahead of current
+//   - OSDs aren't already ahead of the mons
+//   - no OSD is more than two major releases behind the newest mon
+//   - rgw and mds aren't already ahead of the mons
+//
+// current is the version the mons are currently running, since it's the mons
+// that are driven to target first; a cluster with OSDs intentionally lagging
+// the mons by up to maxOsdMonMajorLag is not itself an unsupported jump.
+// versions is the current 'ceph versions' breakdown used to check the rest of
+// the cluster's existing state.
+func ValidateUpgradePath(current, target cephver.CephVersion, versions *CephDaemonsVersions) error {
+	if target.Major-current.Major > maxSupportedMajorJump {
+		return errors.Errorf("upgrading from %s to %s jumps more than %d major version, ceph does not support this", current.String(), target.String(), maxSupportedMajorJump)
+	}
+
+	monVersions, err := extractVersions(versions.Mon)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse mon versions")
+	}
+	if len(monVersions) == 0 {
+		return errors.New("no monitors found in ceph versions output")
+	}
+
+	oldestMon := oldestVersion(monVersions)
+	newestMon := newestVersion(monVersions)
+
+	osdVersions, err := extractVersions(versions.Osd)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse osd versions")
+	}
+	if len(osdVersions) > 0 {
+		newestOSD := newestVersion(osdVersions)
+		if newestOSD.IsAtLeast(target) && !oldestMon.IsAtLeast(target) {
+			return errors.Errorf("osd.%s is already on %s but mon.%s has not been upgraded yet; mons must be upgraded before osds", newestOSD.String(), target.String(), oldestMon.String())
+		}
+
+		oldestOSD := oldestVersion(osdVersions)
+		if newestMon.Major-oldestOSD.Major > maxOsdMonMajorLag {
+			return errors.Errorf("osd.%s is more than %d major releases behind mon.%s", oldestOSD.String(), maxOsdMonMajorLag, newestMon.String())
+		}
+	}
+
+	if err := validateNotAheadOfMons("rgw", versions.Rgw, newestMon); err != nil {
+		return err
+	}
+	if err := validateNotAheadOfMons("mds", versions.Mds, newestMon); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateNotAheadOfMons returns an error if any daemon in daemonVersions is
+// newer than newestMon; mons must always lead the rest of the cluster.
+func validateNotAheadOfMons(daemonType string, daemonVersions map[string]int, newestMon cephver.CephVersion) error {
+	versions, err := extractVersions(daemonVersions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s versions", daemonType)
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	newest := newestVersion(versions)
+	if newest.IsAtLeast(newestMon) && !newestMon.IsAtLeast(newest) {
+		return errors.Errorf("%s.%s is ahead of mon.%s, mons must always be upgraded first", daemonType, newest.String(), newestMon.String())
+	}
+
+	return nil
+}
+
+// RequireOsdReleaseMatches checks that the cluster's 'require-osd-release'
+// setting matches the release the mons are currently running, since a
+// mismatch there means OSDs could be stopped for an upgrade that hasn't
+// actually been permitted cluster-wide yet.
+func RequireOsdReleaseMatches(context *clusterd.Context, clusterInfo *ClusterInfo, monVersion cephver.CephVersion) error {
+	release, err := getRequireOsdRelease(context, clusterInfo)
+	if err != nil {
+		return errors.Wrap(err, "failed to get require-osd-release")
+	}
+
+	name := releaseName(monVersion)
+	if name == "" {
+		// we don't have a mapping for this release yet; don't block the
+		// upgrade on a check we can't actually perform
+		logger.Debugf("no known release name for ceph version %s, skipping require-osd-release check", monVersion.String())
+		return nil
+	}
+
+	if release != "" && release != name {
+		return errors.Errorf("require-osd-release is %q but mons are running %q", release, name)
+	}
+
+	return nil
+}
+
+// getRequireOsdRelease reads the 'require_osd_release' field off 'ceph osd
+// dump'.
+func getRequireOsdRelease(context *clusterd.Context, clusterInfo *ClusterInfo) (string, error) {
+	args := []string{"osd", "dump"}
+	buf, err := NewCephCommand(context, clusterInfo, args).Run()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to run 'ceph osd dump'")
+	}
+
+	var dump struct {
+		RequireOsdRelease string `json:"require_osd_release"`
+	}
+	if err := json.Unmarshal(buf, &dump); err != nil {
+		return "", errors.Wrap(err, "failed to parse 'ceph osd dump' output")
+	}
+
+	return dump.RequireOsdRelease, nil
+}
+
+// releaseName maps a CephVersion's major version to its release name, e.g.
+// 15 -> "octopus", so it can be compared against 'require-osd-release'.
+func releaseName(v cephver.CephVersion) string {
+	switch v.Major {
+	case 14:
+		return "nautilus"
+	case 15:
+		return "octopus"
+	case 16:
+		return "pacific"
+	case 17:
+		return "quincy"
+	case 18:
+		return "reef"
+	case 19:
+		return "squid"
+	default:
+		return ""
+	}
+}
+
+// extractVersions parses each 'ceph version ...' key of a daemon version map
+// into a CephVersion.
+func extractVersions(daemonVersions map[string]int) ([]cephver.CephVersion, error) {
+	versions := make([]cephver.CephVersion, 0, len(daemonVersions))
+	for v := range daemonVersions {
+		version, err := cephver.ExtractCephVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+
+	return versions, nil
+}
+
+// oldestMonVersion returns the oldest mon version currently running, i.e. the
+// version that ValidateUpgradePath's major-jump check should treat as
+// "current", since the mons are always upgraded first and it's their version
+// that's actually being driven to target.
+func oldestMonVersion(versions *CephDaemonsVersions) (cephver.CephVersion, error) {
+	monVersions, err := extractVersions(versions.Mon)
+	if err != nil {
+		return cephver.CephVersion{}, errors.Wrap(err, "failed to parse mon versions")
+	}
+	if len(monVersions) == 0 {
+		return cephver.CephVersion{}, errors.New("no monitors found in ceph versions output")
+	}
+
+	return oldestVersion(monVersions), nil
+}
+
+func oldestVersion(versions []cephver.CephVersion) cephver.CephVersion {
+	return extremeVersion(versions, false)
+}
+
+func newestVersion(versions []cephver.CephVersion) cephver.CephVersion {
+	return extremeVersion(versions, true)
+}
+
+// extremeVersion returns the newest version in versions when newest is true,
+// or the oldest otherwise.
+func extremeVersion(versions []cephver.CephVersion, newest bool) cephver.CephVersion {
+	result := versions[0]
+	for _, v := range versions[1:] {
+		if v.IsAtLeast(result) == newest {
+			result = v
+		}
+	}
+
+	return result
+}
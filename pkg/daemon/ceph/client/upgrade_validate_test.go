@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	cephver "github.com/rook/rook/pkg/operator/ceph/version"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeRequireOsdReleaseContext(requireOsdRelease string) *clusterd.Context {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return fmt.Sprintf(`{"require_osd_release":%q}`, requireOsdRelease), nil
+		},
+	}
+	return &clusterd.Context{Executor: executor}
+}
+
+// cephVersionString builds a 'ceph versions' map key in the format Ceph
+// itself reports, e.g. "ceph version 14.2.10 (...) nautilus (stable)".
+func cephVersionString(major, minor, extra int, release string) string {
+	return fmt.Sprintf("ceph version %d.%d.%d (0000000000000000000000000000000000000000) %s (stable)", major, minor, extra, release)
+}
+
+func TestValidateUpgradePath(t *testing.T) {
+	nautilus := cephver.CephVersion{Major: 14, Minor: 2, Extra: 10}
+	octopus := cephver.CephVersion{Major: 15, Minor: 2, Extra: 8}
+	pacific := cephver.CephVersion{Major: 16, Minor: 2, Extra: 0}
+
+	t.Run("rejects jumping more than one major version", func(t *testing.T) {
+		versions := &CephDaemonsVersions{
+			Mon: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 3},
+		}
+		err := ValidateUpgradePath(nautilus, pacific, versions)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "jumps more than")
+	})
+
+	t.Run("allows a single major version upgrade", func(t *testing.T) {
+		versions := &CephDaemonsVersions{
+			Mon: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 3},
+			Osd: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 12},
+			Rgw: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 1},
+			Mds: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 1},
+		}
+		err := ValidateUpgradePath(nautilus, octopus, versions)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects osds ahead of mons", func(t *testing.T) {
+		versions := &CephDaemonsVersions{
+			Mon: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 3},
+			Osd: map[string]int{cephVersionString(15, 2, 8, "octopus"): 12},
+		}
+		err := ValidateUpgradePath(nautilus, octopus, versions)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "mons must be upgraded before osds")
+	})
+
+	t.Run("allows osds within the max mon lag", func(t *testing.T) {
+		versions := &CephDaemonsVersions{
+			Mon: map[string]int{cephVersionString(16, 2, 0, "pacific"): 3},
+			Osd: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 12},
+		}
+		err := ValidateUpgradePath(pacific, pacific, versions)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects osds more than two majors behind the newest mon", func(t *testing.T) {
+		versions := &CephDaemonsVersions{
+			Mon: map[string]int{cephVersionString(16, 2, 0, "pacific"): 3},
+			Osd: map[string]int{cephVersionString(12, 2, 0, "luminous"): 12},
+		}
+		err := ValidateUpgradePath(pacific, pacific, versions)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "major releases behind")
+	})
+
+	t.Run("rejects rgw ahead of mons", func(t *testing.T) {
+		versions := &CephDaemonsVersions{
+			Mon: map[string]int{cephVersionString(14, 2, 10, "nautilus"): 3},
+			Rgw: map[string]int{cephVersionString(15, 2, 8, "octopus"): 1},
+		}
+		err := ValidateUpgradePath(nautilus, octopus, versions)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "rgw")
+	})
+
+	t.Run("requires at least one monitor to be reported", func(t *testing.T) {
+		versions := &CephDaemonsVersions{}
+		err := ValidateUpgradePath(nautilus, octopus, versions)
+		assert.Error(t, err)
+	})
+}
+
+func TestRequireOsdReleaseMatches(t *testing.T) {
+	nautilus := cephver.CephVersion{Major: 14, Minor: 2, Extra: 10}
+
+	t.Run("passes when require-osd-release matches the mons' release", func(t *testing.T) {
+		context := fakeRequireOsdReleaseContext("nautilus")
+		err := RequireOsdReleaseMatches(context, &ClusterInfo{}, nautilus)
+		assert.NoError(t, err)
+	})
+
+	t.Run("fails when require-osd-release lags the mons' release", func(t *testing.T) {
+		context := fakeRequireOsdReleaseContext("mimic")
+		err := RequireOsdReleaseMatches(context, &ClusterInfo{}, nautilus)
+		assert.Error(t, err)
+	})
+
+	t.Run("skips the check for a release with no known mapping", func(t *testing.T) {
+		unknown := cephver.CephVersion{Major: 99, Minor: 0, Extra: 0}
+		context := fakeRequireOsdReleaseContext("mimic")
+		err := RequireOsdReleaseMatches(context, &ClusterInfo{}, unknown)
+		assert.NoError(t, err)
+	})
+}
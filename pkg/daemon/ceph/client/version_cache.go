@@ -0,0 +1,117 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// defaultVersionCacheTTL bounds how long a VersionCache will serve a
+// previously fetched 'ceph versions' result before re-querying the cluster.
+const defaultVersionCacheTTL = 30 * time.Second
+
+// VersionCache memoizes the result of 'ceph versions' for a short TTL so that
+// callers iterating over many daemons during an upgrade don't each pay for a
+// fresh exec. It is safe for concurrent use.
+type VersionCache struct {
+	ttl time.Duration
+
+	mux       sync.Mutex
+	versions  *CephDaemonsVersions
+	fetchedAt time.Time
+}
+
+// NewVersionCache returns a VersionCache that refreshes itself at most once
+// per ttl. A ttl of zero falls back to defaultVersionCacheTTL.
+func NewVersionCache(ttl time.Duration) *VersionCache {
+	if ttl <= 0 {
+		ttl = defaultVersionCacheTTL
+	}
+
+	return &VersionCache{ttl: ttl}
+}
+
+// Get returns the cached daemon versions, refreshing them first if the cache
+// is empty or has expired.
+func (c *VersionCache) Get(context *clusterd.Context, clusterInfo *ClusterInfo) (*CephDaemonsVersions, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.versions != nil && time.Since(c.fetchedAt) < c.ttl {
+		return c.versions, nil
+	}
+
+	versions, err := GetAllCephDaemonVersions(context, clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	c.versions = versions
+	c.fetchedAt = time.Now()
+
+	return c.versions, nil
+}
+
+// Refresh unconditionally re-queries 'ceph versions' and updates the cache,
+// regardless of whether the TTL has expired.
+func (c *VersionCache) Refresh(context *clusterd.Context, clusterInfo *ClusterInfo) error {
+	versions, err := GetAllCephDaemonVersions(context, clusterInfo)
+	if err != nil {
+		return errors.Wrap(err, "failed to refresh ceph daemon versions cache")
+	}
+
+	c.mux.Lock()
+	c.versions = versions
+	c.fetchedAt = time.Now()
+	c.mux.Unlock()
+
+	return nil
+}
+
+// Bust discards the cached value so the next Get call is forced to re-query
+// the cluster. It's used after events that we know change daemon versions,
+// such as enabling a new osd release or a daemon restart completing.
+func (c *VersionCache) Bust() {
+	c.mux.Lock()
+	c.versions = nil
+	c.mux.Unlock()
+}
+
+// cachedCephDaemonVersions returns clusterInfo.VersionCache's view of 'ceph
+// versions' when a cache is configured, falling back to an uncached query
+// otherwise so existing callers without a cache keep working unchanged.
+func cachedCephDaemonVersions(context *clusterd.Context, clusterInfo *ClusterInfo) (*CephDaemonsVersions, error) {
+	if clusterInfo.VersionCache == nil {
+		return GetAllCephDaemonVersions(context, clusterInfo)
+	}
+
+	return clusterInfo.VersionCache.Get(context, clusterInfo)
+}
+
+// BustVersionCache invalidates clusterInfo's version cache, if configured. It
+// is a no-op when no cache is set. Callers should invoke this after a daemon
+// restart completes so a subsequent ok-to-stop check cannot be fooled by a
+// stale pre-restart version.
+func BustVersionCache(clusterInfo *ClusterInfo) {
+	if clusterInfo.VersionCache != nil {
+		clusterInfo.VersionCache.Bust()
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeVersionsContext(calls *int) *clusterd.Context {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			*calls++
+			return `{"mon":{"ceph version 14.2.10 (0) nautilus (stable)":3}}`, nil
+		},
+	}
+	return &clusterd.Context{Executor: executor}
+}
+
+func TestVersionCacheGet(t *testing.T) {
+	var calls int
+	context := fakeVersionsContext(&calls)
+	clusterInfo := &ClusterInfo{}
+
+	cache := NewVersionCache(time.Hour)
+
+	versions, err := cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, versions.Mon["ceph version 14.2.10 (0) nautilus (stable)"])
+	assert.Equal(t, 1, calls)
+
+	// a second Get within the ttl is served from cache, no new exec
+	_, err = cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// once the ttl has elapsed, Get refreshes from the cluster again
+	cache.fetchedAt = time.Now().Add(-2 * time.Hour)
+	_, err = cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestVersionCacheRefresh(t *testing.T) {
+	var calls int
+	context := fakeVersionsContext(&calls)
+	clusterInfo := &ClusterInfo{}
+
+	cache := NewVersionCache(time.Hour)
+	_, err := cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// Refresh re-queries even though the ttl hasn't expired
+	err = cache.Refresh(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestVersionCacheBust(t *testing.T) {
+	var calls int
+	context := fakeVersionsContext(&calls)
+	clusterInfo := &ClusterInfo{}
+
+	cache := NewVersionCache(time.Hour)
+	_, err := cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	cache.Bust()
+
+	_, err = cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestBustVersionCacheNoopWithoutCache(t *testing.T) {
+	// BustVersionCache must not panic when the cluster has no cache configured
+	BustVersionCache(&ClusterInfo{})
+}
+
+func TestOkToContinueBustsVersionCache(t *testing.T) {
+	var calls int
+	context := fakeVersionsContext(&calls)
+	cache := NewVersionCache(time.Hour)
+	clusterInfo := &ClusterInfo{VersionCache: cache}
+
+	_, err := cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+
+	// OkToContinue is only called once the caller has already restarted the
+	// daemon, so it must not let the next OkToStop be fooled by the
+	// pre-restart version still sitting in the cache.
+	err = OkToContinue(context, clusterInfo, "rook-ceph-osd-0", "osd", "osd0")
+	assert.NoError(t, err)
+
+	_, err = cache.Get(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCachedCephDaemonVersionsUsesCache(t *testing.T) {
+	var calls int
+	context := fakeVersionsContext(&calls)
+	clusterInfo := &ClusterInfo{VersionCache: NewVersionCache(time.Hour)}
+
+	_, err := cachedCephDaemonVersions(context, clusterInfo)
+	assert.NoError(t, err)
+	_, err = cachedCephDaemonVersions(context, clusterInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}